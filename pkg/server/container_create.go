@@ -0,0 +1,52 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	runtime "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// CreateContainer creates a new container in the specified PodSandbox.
+//
+// Only the sandbox readiness gate is reproduced here: container spec
+// generation, snapshot creation, and task setup are the bulk of the real
+// implementation and are out of scope for this change, which is about
+// closing the race between sandbox teardown and container creation.
+func (c *criService) CreateContainer(ctx context.Context, r *runtime.CreateContainerRequest) (*runtime.CreateContainerResponse, error) {
+	sandbox, err := c.sandboxStore.Get(r.GetPodSandboxId())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find sandbox %q", r.GetPodSandboxId())
+	}
+
+	if c.metrics != nil {
+		defer func(start time.Time) {
+			c.metrics.createContainer.WithValues(sandbox.RuntimeHandler).UpdateSince(start)
+		}(time.Now())
+	}
+
+	// Reject container creation outright once StopPodSandbox has moved the
+	// sandbox out of StateReady, so a CreateContainer racing with
+	// StopPodSandbox can no longer produce a running container behind it.
+	if err := c.checkSandboxReady(sandbox); err != nil {
+		return nil, errors.Wrap(err, "failed to create container")
+	}
+	return nil, errors.New("CreateContainer is not implemented in this tree beyond the sandbox readiness check")
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	runtime "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// StartContainer starts a previously created container.
+//
+// Only the sandbox readiness gate is reproduced here; see CreateContainer in
+// container_create.go for why it's needed and what's out of scope.
+func (c *criService) StartContainer(ctx context.Context, r *runtime.StartContainerRequest) (*runtime.StartContainerResponse, error) {
+	container, err := c.containerStore.Get(r.GetContainerId())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find container %q", r.GetContainerId())
+	}
+	sandbox, err := c.sandboxStore.Get(container.SandboxID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find sandbox %q for container %q", container.SandboxID, r.GetContainerId())
+	}
+
+	if c.metrics != nil {
+		defer func(start time.Time) {
+			c.metrics.startContainer.WithValues(sandbox.RuntimeHandler).UpdateSince(start)
+		}(time.Now())
+	}
+
+	// A sandbox that's already StateStopping may have containers left behind
+	// by StopPodSandbox's force-stop loop that haven't been started
+	// yet; reject starting them rather than racing StopPodSandbox.
+	if err := c.checkSandboxReady(sandbox); err != nil {
+		return nil, errors.Wrap(err, "failed to start container")
+	}
+	return nil, errors.New("StartContainer is not implemented in this tree beyond the sandbox readiness check")
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	runtime "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// StopContainer stops a running container with a grace period.
+//
+// Only the latency timer is reproduced here; the real implementation's
+// graceful-stop logic is what criService.stopContainer (called directly,
+// without going through this RPC, by StopPodSandbox's force-stop loop in
+// sandbox_stop.go) implements, and is out of scope for this change.
+func (c *criService) StopContainer(ctx context.Context, r *runtime.StopContainerRequest) (*runtime.StopContainerResponse, error) {
+	container, err := c.containerStore.Get(r.GetContainerId())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find container %q", r.GetContainerId())
+	}
+	sandbox, err := c.sandboxStore.Get(container.SandboxID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find sandbox %q for container %q", container.SandboxID, r.GetContainerId())
+	}
+
+	if c.metrics != nil {
+		defer func(start time.Time) {
+			c.metrics.stopContainer.WithValues(sandbox.RuntimeHandler).UpdateSince(start)
+		}(time.Now())
+	}
+
+	if err := c.stopContainer(ctx, container, r.GetTimeout()); err != nil {
+		return nil, errors.Wrapf(err, "failed to stop container %q", r.GetContainerId())
+	}
+	return &runtime.StopContainerResponse{}, nil
+}
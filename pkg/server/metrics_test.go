@@ -0,0 +1,31 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	metrics "github.com/docker/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSandboxMetricsIfEnabled(t *testing.T) {
+	ns := metrics.NewNamespace("containerd", "cri_test", nil)
+
+	assert.Nil(t, newSandboxMetricsIfEnabled(true, ns), "disabled metrics should yield a nil *sandboxMetrics")
+	assert.NotNil(t, newSandboxMetricsIfEnabled(false, ns), "metrics should be registered when not disabled")
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"container/ring"
+	"sync"
+	"time"
+)
+
+// SandboxEventType identifies the stage of the sandbox teardown (or setup)
+// lifecycle an event was emitted for.
+type SandboxEventType string
+
+const (
+	// SandboxStopping is emitted as soon as StopPodSandbox has moved the
+	// sandbox to sandboxstore.StateStopping, before any cleanup is attempted.
+	SandboxStopping SandboxEventType = "SandboxStopping"
+	// SandboxContainerKilled is emitted once the sandbox container has been
+	// killed and is confirmed stopped.
+	SandboxContainerKilled SandboxEventType = "SandboxContainerKilled"
+	// SandboxContainerKillFailed is emitted in place of SandboxContainerKilled
+	// when killing or waiting for the sandbox container failed.
+	SandboxContainerKillFailed SandboxEventType = "SandboxContainerKillFailed"
+	// SandboxNetworkTornDown is emitted once every CNI network the sandbox
+	// was attached to has been removed.
+	SandboxNetworkTornDown SandboxEventType = "SandboxNetworkTornDown"
+	// SandboxNetworkTeardownFailed is emitted in place of
+	// SandboxNetworkTornDown when tearing down the sandbox's network failed.
+	SandboxNetworkTeardownFailed SandboxEventType = "SandboxNetworkTeardownFailed"
+	// SandboxStopped is emitted once StopPodSandbox has completed every
+	// cleanup step successfully.
+	SandboxStopped SandboxEventType = "SandboxStopped"
+)
+
+// SandboxEvent is a single point-in-time notification about a sandbox's
+// lifecycle, published on criService's sandboxEvents bus so that external
+// controllers (audit, network policy GC, storage reclaim) can react to
+// sandbox teardown without polling StopPodSandbox/PodSandboxStatus.
+//
+// The gRPC-facing WatchSandboxEvents API and forwarding these into
+// containerd's own event exchange both depend on generated protobuf types
+// for SandboxEvent that don't exist in this tree; sandboxEventBus is the
+// self-contained piece that API would be backed by.
+type SandboxEvent struct {
+	Type      SandboxEventType
+	SandboxID string
+	Timestamp time.Time
+	// Err is set for the *Failed event variants, nil otherwise.
+	Err error
+}
+
+// sandboxEventBus is a bounded, replayable pub/sub bus for SandboxEvent. It
+// retains the last capacity events in a ring buffer so that a subscriber
+// which reconnects can replay everything published since a given timestamp,
+// instead of only seeing events from the moment it (re)subscribes.
+type sandboxEventBus struct {
+	mu   sync.Mutex
+	subs map[chan SandboxEvent]struct{}
+	buf  *ring.Ring
+}
+
+// newSandboxEventBus creates a bus retaining up to capacity past events for
+// replay.
+func newSandboxEventBus(capacity int) *sandboxEventBus {
+	return &sandboxEventBus{
+		subs: make(map[chan SandboxEvent]struct{}),
+		buf:  ring.New(capacity),
+	}
+}
+
+// publish fans e out to every live subscriber and records it for replay. It
+// is a no-op if b is nil, so call sites don't need to branch on whether the
+// bus was constructed. Slow subscribers are dropped rather than blocking the
+// publisher: the StopPodSandbox path must never stall on a reader that's
+// fallen behind.
+func (b *sandboxEventBus) publish(e SandboxEvent) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Value = e
+	b.buf = b.buf.Next()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribeBacklog is how much headroom beyond a subscriber's replay backlog
+// is left in its channel for events published while it's still draining that
+// backlog.
+const subscribeBacklog = 64
+
+// subscribe registers a new subscriber, returning a channel fed by every
+// event published from now on, preceded by a replay of buffered events whose
+// Timestamp is after since (the zero Time replays everything buffered). The
+// returned func unregisters the subscriber and must be called when the
+// caller is done reading.
+func (b *sandboxEventBus) subscribe(since time.Time) (<-chan SandboxEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []SandboxEvent
+	b.buf.Do(func(v interface{}) {
+		if v == nil {
+			return
+		}
+		if e := v.(SandboxEvent); e.Timestamp.After(since) {
+			replay = append(replay, e)
+		}
+	})
+
+	// Size the channel to hold the entire replay plus headroom, so sending
+	// the replay below can never block. A blocking send here, while b.mu is
+	// held, would wedge every subsequent publish() — called synchronously
+	// from StopPodSandbox's hot path — behind this subscriber for as long as
+	// nothing drains it.
+	ch := make(chan SandboxEvent, len(replay)+subscribeBacklog)
+	for _, e := range replay {
+		ch <- e
+	}
+
+	b.subs[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
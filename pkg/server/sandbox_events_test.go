@@ -0,0 +1,116 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandboxEventBusPublishSubscribe(t *testing.T) {
+	bus := newSandboxEventBus(8)
+	ch, unsubscribe := bus.subscribe(time.Time{})
+	defer unsubscribe()
+
+	bus.publish(SandboxEvent{Type: SandboxStopping, SandboxID: "test-id"})
+
+	select {
+	case e := <-ch:
+		assert.Equal(t, SandboxStopping, e.Type)
+		assert.Equal(t, "test-id", e.SandboxID)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for published event")
+	}
+}
+
+func TestSandboxEventBusReplay(t *testing.T) {
+	bus := newSandboxEventBus(8)
+
+	past := time.Now()
+	bus.publish(SandboxEvent{Type: SandboxStopping, SandboxID: "test-id", Timestamp: past})
+	cutoff := past.Add(time.Millisecond)
+	future := cutoff.Add(time.Millisecond)
+	bus.publish(SandboxEvent{Type: SandboxStopped, SandboxID: "test-id", Timestamp: future})
+
+	ch, unsubscribe := bus.subscribe(cutoff)
+	defer unsubscribe()
+
+	select {
+	case e := <-ch:
+		assert.Equal(t, SandboxStopped, e.Type, "replay should skip events at or before the cutoff")
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for replayed event")
+	}
+
+	select {
+	case e, ok := <-ch:
+		require.True(t, ok, "should not receive extra events after the one replayed event")
+		t.Fatalf("unexpected extra event: %+v", e)
+	default:
+	}
+}
+
+// TestSandboxEventBusSubscribeLargeReplayDoesNotDeadlock guards against a
+// subscribe that blocks forever (holding b.mu) when its replay backlog
+// exceeds the channel's buffer: that would wedge every subsequent publish()
+// behind it, since publish() is called synchronously from StopPodSandbox.
+func TestSandboxEventBusSubscribeLargeReplayDoesNotDeadlock(t *testing.T) {
+	const numEvents = 100
+	bus := newSandboxEventBus(numEvents * 2)
+	since := time.Now()
+	for i := 0; i < numEvents; i++ {
+		bus.publish(SandboxEvent{Type: SandboxStopping, SandboxID: "test-id", Timestamp: since.Add(time.Duration(i+1) * time.Millisecond)})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ch, unsubscribe := bus.subscribe(since)
+		defer unsubscribe()
+		for i := 0; i < numEvents; i++ {
+			<-ch
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("subscribe deadlocked on a replay backlog larger than the channel buffer")
+	}
+
+	// publish() must not be blocked behind the subscriber above either.
+	publishDone := make(chan struct{})
+	go func() {
+		bus.publish(SandboxEvent{Type: SandboxStopped, SandboxID: "test-id"})
+		close(publishDone)
+	}()
+	select {
+	case <-publishDone:
+	case <-time.After(3 * time.Second):
+		t.Fatal("publish() blocked behind a prior subscribe() call")
+	}
+}
+
+func TestSandboxEventBusPublishOnNilBusIsNoop(t *testing.T) {
+	var bus *sandboxEventBus
+	assert.NotPanics(t, func() {
+		bus.publish(SandboxEvent{Type: SandboxStopping, SandboxID: "test-id"})
+	})
+}
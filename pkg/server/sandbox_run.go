@@ -0,0 +1,42 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	runtime "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// RunPodSandbox creates and starts a pod-level sandbox.
+//
+// Only the latency timer is reproduced here: CNI setup, the sandbox
+// container's creation, and persisting the resulting sandboxstore.Sandbox
+// (with its State set to StateReady and, per teardownPod's
+// podNetworks/AttachedNetworks, the list of networks RunPodSandbox attached
+// to) are the bulk of the real implementation and are out of scope for this
+// change.
+func (c *criService) RunPodSandbox(ctx context.Context, r *runtime.RunPodSandboxRequest) (*runtime.RunPodSandboxResponse, error) {
+	if c.metrics != nil {
+		defer func(start time.Time) {
+			c.metrics.runPodSandbox.WithValues(r.GetRuntimeHandler()).UpdateSince(start)
+		}(time.Now())
+	}
+	return nil, errors.New("RunPodSandbox is not implemented in this tree")
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"github.com/pkg/errors"
+
+	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
+)
+
+// checkSandboxReady returns an error if the sandbox is not in StateReady.
+// CreateContainer and StartContainer must call this before creating or
+// starting a container in the sandbox: once StopPodSandbox has moved the
+// sandbox to StateStopping, every later check fails. The check is a single
+// read of the state; a call that passed it before that transition is not
+// stopped by it.
+func (c *criService) checkSandboxReady(sandbox sandboxstore.Sandbox) error {
+	state := sandbox.Status.Get().State
+	if state != sandboxstore.StateReady {
+		return errors.Errorf("sandbox %q is in %s state, not ready to create/start container", sandbox.ID, state)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
+)
+
+func TestCheckSandboxReady(t *testing.T) {
+	c := &criService{}
+	for desc, test := range map[string]struct {
+		state   sandboxstore.State
+		wantErr bool
+	}{
+		"ready sandbox should pass": {
+			state:   sandboxstore.StateReady,
+			wantErr: false,
+		},
+		"not ready sandbox should be rejected": {
+			state:   sandboxstore.StateNotReady,
+			wantErr: true,
+		},
+		"unknown sandbox should be rejected": {
+			state:   sandboxstore.StateUnknown,
+			wantErr: true,
+		},
+		"stopping sandbox should be rejected": {
+			state:   sandboxstore.StateStopping,
+			wantErr: true,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			sandbox := sandboxstore.NewSandbox("test-id", nil, sandboxstore.Status{State: test.state})
+			err := c.checkSandboxReady(sandbox)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestCheckSandboxReadyConcurrentWithStop actually exercises the race the
+// StateStopping transition is meant to close: a goroutine simulating
+// StopPodSandbox repeatedly flips the sandbox to StateStopping concurrently
+// with goroutines simulating CreateContainer repeatedly calling
+// checkSandboxReady, with no synchronization forcing a particular
+// interleaving between them. Run with `go test -race` to additionally
+// confirm sandbox.Status's locking makes this safe. Once the stopper
+// goroutine finishes, every subsequent checkSandboxReady call must fail:
+// there's no interleaving in which CreateContainer can still observe
+// StateReady afterwards.
+func TestCheckSandboxReadyConcurrentWithStop(t *testing.T) {
+	c := &criService{}
+	sandbox := sandboxstore.NewSandbox("test-id", nil, sandboxstore.Status{State: sandboxstore.StateReady})
+
+	stopperDone := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(stopperDone)
+		for i := 0; i < 100; i++ {
+			_ = sandbox.Status.Update(func(status sandboxstore.Status) (sandboxstore.Status, error) {
+				status.State = sandboxstore.StateStopping
+				return status, nil
+			})
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				c.checkSandboxReady(sandbox)
+				select {
+				case <-stopperDone:
+					return
+				default:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Error(t, c.checkSandboxReady(sandbox), "no container creation should be able to observe the sandbox as ready once StopPodSandbox has run")
+}
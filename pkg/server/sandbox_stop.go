@@ -17,12 +17,15 @@ limitations under the License.
 package server
 
 import (
+	"strings"
 	"syscall"
 	"time"
 
+	containerd "github.com/containerd/containerd"
 	eventtypes "github.com/containerd/containerd/api/events"
 	"github.com/containerd/containerd/errdefs"
 	cni "github.com/containerd/go-cni"
+	"github.com/docker/docker/pkg/signal"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
@@ -34,6 +37,17 @@ import (
 
 // StopPodSandbox stops the sandbox. If there are any running containers in the
 // sandbox, they should be forcibly terminated.
+//
+// StopPodSandbox is idempotent and does not abort partway through on a single
+// step's failure: it attempts every cleanup step, records in the sandbox
+// status which steps already succeeded, and returns an aggregated error for
+// the ones that didn't. A subsequent StopPodSandbox (or RemovePodSandbox)
+// call resumes from that recorded state: unmounting the sandbox files,
+// stopping the sandbox container and tearing down the CNI networks are
+// skipped once recorded as done. The force-stop loop over the sandbox's
+// containers runs on every call, and removal of the network namespace is not
+// recorded: NetNS.Remove is called again on every call once the network is
+// recorded as torn down or the namespace is reported closed.
 func (c *criService) StopPodSandbox(ctx context.Context, r *runtime.StopPodSandboxRequest) (*runtime.StopPodSandboxResponse, error) {
 	sandbox, err := c.sandboxStore.Get(r.GetPodSandboxId())
 	if err != nil {
@@ -43,9 +57,32 @@ func (c *criService) StopPodSandbox(ctx context.Context, r *runtime.StopPodSandb
 	// Use the full sandbox id.
 	id := sandbox.ID
 
+	defer func(start time.Time) {
+		if c.metrics != nil {
+			c.metrics.stopPodSandbox.WithValues(sandbox.RuntimeHandler).UpdateSince(start)
+		}
+	}(time.Now())
+
+	// Record the state before transitioning to StateStopping below, it determines
+	// whether the sandbox container itself still needs to be stopped further down.
+	state := sandbox.Status.Get().State
+
+	// Move the sandbox to StateStopping before tearing down its containers, so that
+	// a CreateContainer/StartContainer racing with this call sees the sandbox is no
+	// longer StateReady and is rejected with a clear error instead of possibly
+	// producing a running container after this loop has finished.
+	if err := sandbox.Status.Update(func(status sandboxstore.Status) (sandboxstore.Status, error) {
+		status.State = sandboxstore.StateStopping
+		return status, nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to set sandbox %q to stopping state", id)
+	}
+	c.sandboxEvents.publish(SandboxEvent{Type: SandboxStopping, SandboxID: id, Timestamp: time.Now()})
+
+	var errs []error
+
 	// Stop all containers inside the sandbox. This terminates the container forcibly,
 	// and container may still be created, so production should not rely on this behavior.
-	// TODO(random-liu): Introduce a state in sandbox to avoid future container creation.
 	containers := c.containerStore.List()
 	for _, container := range containers {
 		if container.SandboxID != id {
@@ -53,20 +90,38 @@ func (c *criService) StopPodSandbox(ctx context.Context, r *runtime.StopPodSandb
 		}
 		// Forcibly stop the container. Do not use `StopContainer`, because it introduces a race
 		// if a container is removed after list.
-		if err = c.stopContainer(ctx, container, 0); err != nil {
-			return nil, errors.Wrapf(err, "failed to stop container %q", container.ID)
+		if err := c.stopContainer(ctx, container, 0); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to stop container %q", container.ID))
 		}
 	}
 
-	if err := c.unmountSandboxFiles(id, sandbox.Config); err != nil {
-		return nil, errors.Wrap(err, "failed to unmount sandbox files")
+	if sandbox.Status.Get().Unmounted {
+		logrus.Debugf("sandbox files for %q were already unmounted by a previous call, skipping", id)
+	} else if err := c.timedUnmountSandboxFiles(sandbox); err != nil {
+		errs = append(errs, errors.Wrap(err, "failed to unmount sandbox files"))
+	} else if err := sandbox.Status.Update(func(status sandboxstore.Status) (sandboxstore.Status, error) {
+		status.Unmounted = true
+		return status, nil
+	}); err != nil {
+		errs = append(errs, errors.Wrap(err, "failed to record sandbox files as unmounted"))
 	}
 
-	// Only stop sandbox container when it's running or unknown.
-	state := sandbox.Status.Get().State
-	if state == sandboxstore.StateReady || state == sandboxstore.StateUnknown {
+	if !needsSandboxContainerStop(state, sandbox.Status.Get()) {
+		logrus.Debugf("sandbox container %q was not running or was already stopped by a previous call, skipping", id)
+	} else {
+		evt := SandboxEvent{Type: SandboxContainerKilled, SandboxID: id, Timestamp: time.Now()}
 		if err := c.stopSandboxContainer(ctx, sandbox); err != nil {
-			return nil, errors.Wrapf(err, "failed to stop sandbox container %q in %q state", id, state)
+			errs = append(errs, errors.Wrapf(err, "failed to stop sandbox container %q in %q state", id, state))
+			evt.Type, evt.Err = SandboxContainerKillFailed, err
+			c.sandboxEvents.publish(evt)
+		} else if err := sandbox.Status.Update(func(status sandboxstore.Status) (sandboxstore.Status, error) {
+			status.ContainerStopped = true
+			return status, nil
+		}); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to record sandbox container as stopped"))
+			c.sandboxEvents.publish(evt)
+		} else {
+			c.sandboxEvents.publish(evt)
 		}
 	}
 
@@ -75,28 +130,88 @@ func (c *criService) StopPodSandbox(ctx context.Context, r *runtime.StopPodSandb
 		netNSPath := sandbox.NetNSPath
 		// Use empty netns path if netns is not available. This is defined in:
 		// https://github.com/containernetworking/cni/blob/v0.7.0-alpha1/SPEC.md
-		if closed, err := sandbox.NetNS.Closed(); err != nil {
-			return nil, errors.Wrap(err, "failed to check network namespace closed")
-		} else if closed {
-			netNSPath = ""
-		}
-		if err := c.teardownPod(id, netNSPath, sandbox.Config); err != nil {
-			return nil, errors.Wrapf(err, "failed to destroy network for sandbox %q", id)
-		}
-		if err = sandbox.NetNS.Remove(); err != nil {
-			return nil, errors.Wrapf(err, "failed to remove network namespace for sandbox %q", id)
+		closed, err := sandbox.NetNS.Closed()
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to check network namespace closed"))
+		} else {
+			if closed {
+				netNSPath = ""
+			}
+			if sandbox.Status.Get().NetworkTornDown {
+				logrus.Debugf("network for sandbox %q was already torn down by a previous call, skipping", id)
+			} else if err := c.teardownPod(id, netNSPath, sandbox.Config, sandbox.RuntimeHandler, podNetworks(sandbox)); err != nil {
+				errs = append(errs, errors.Wrapf(err, "failed to destroy network for sandbox %q", id))
+				c.sandboxEvents.publish(SandboxEvent{Type: SandboxNetworkTeardownFailed, SandboxID: id, Timestamp: time.Now(), Err: err})
+			} else if err := sandbox.Status.Update(func(status sandboxstore.Status) (sandboxstore.Status, error) {
+				status.NetworkTornDown = true
+				return status, nil
+			}); err != nil {
+				errs = append(errs, errors.Wrap(err, "failed to record sandbox network as torn down"))
+			} else {
+				c.sandboxEvents.publish(SandboxEvent{Type: SandboxNetworkTornDown, SandboxID: id, Timestamp: time.Now()})
+			}
+			// Only remove the netns once its CNI attachments are known to be gone, or
+			// already reported closed above; otherwise leave it for the retry to find.
+			if sandbox.Status.Get().NetworkTornDown || closed {
+				if err := sandbox.NetNS.Remove(); err != nil {
+					errs = append(errs, errors.Wrapf(err, "failed to remove network namespace for sandbox %q", id))
+				}
+			}
 		}
 	}
 
+	if err := aggregateErrors(errs); err != nil {
+		return nil, err
+	}
+
+	c.sandboxEvents.publish(SandboxEvent{Type: SandboxStopped, SandboxID: id, Timestamp: time.Now()})
 	logrus.Infof("TearDown network for sandbox %q successfully", id)
 
 	return &runtime.StopPodSandboxResponse{}, nil
 }
 
+// needsSandboxContainerStop reports whether StopPodSandbox still needs to
+// stop the sandbox container: it never did for a sandbox whose container
+// never ran (StateNotReady), and it no longer does once ContainerStopped has
+// been persisted. state must be the sandbox's State snapshot taken before
+// StopPodSandbox moved it to StateStopping, so that on a retry — where State
+// is already StateStopping regardless of whether the previous attempt's
+// stopSandboxContainer succeeded — the decision is driven by the persisted
+// ContainerStopped flag instead of being silently skipped forever.
+func needsSandboxContainerStop(state sandboxstore.State, status sandboxstore.Status) bool {
+	if status.ContainerStopped {
+		return false
+	}
+	return state != sandboxstore.StateNotReady
+}
+
+// aggregateErrors combines zero or more errors from independently attempted
+// cleanup steps into a single error, so that StopPodSandbox can keep trying
+// every step instead of returning on the first failure.
+func aggregateErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return errors.Errorf("multiple errors encountered while stopping sandbox: %s", strings.Join(msgs, "; "))
+}
+
 // stopSandboxContainer kills the sandbox container.
 // `task.Delete` is not called here because it will be called when
 // the event monitor handles the `TaskExit` event.
 func (c *criService) stopSandboxContainer(ctx context.Context, sandbox sandboxstore.Sandbox) error {
+	if c.metrics != nil {
+		defer func(start time.Time) {
+			c.metrics.stopSandboxContainer.WithValues(sandbox.RuntimeHandler).UpdateSince(start)
+		}(time.Now())
+	}
+
 	id := sandbox.ID
 	container := sandbox.Container
 	state := sandbox.Status.Get().State
@@ -137,6 +252,22 @@ func (c *criService) stopSandboxContainer(ctx context.Context, sandbox sandboxst
 		}()
 	}
 
+	// Give the sandbox container a chance to shut down cleanly before resorting to
+	// SIGKILL: infrastructure containers may run cleanup hooks on their stop signal
+	// (e.g. flushing conntrack, unregistering from a service mesh) that never get a
+	// chance to run if we kill them outright.
+	gracePeriod := c.sandboxStopGracePeriod(sandbox)
+	if gracePeriod > 0 {
+		stopSignal := getContainerStopSignal(ctx, container)
+		if err := task.Kill(ctx, stopSignal); err != nil && !errdefs.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to send %s to sandbox container", stopSignal)
+		}
+		if err := c.waitSandboxStop(ctx, sandbox, gracePeriod); err == nil {
+			return nil
+		}
+		logrus.Infof("sandbox container %q did not stop within %s of %s, escalating to SIGKILL", id, gracePeriod, stopSignal)
+	}
+
 	// Kill the sandbox container.
 	if err = task.Kill(ctx, syscall.SIGKILL); err != nil && !errdefs.IsNotFound(err) {
 		return errors.Wrap(err, "failed to kill sandbox container")
@@ -145,8 +276,49 @@ func (c *criService) stopSandboxContainer(ctx context.Context, sandbox sandboxst
 	return c.waitSandboxStop(ctx, sandbox, killContainerTimeout)
 }
 
+// sandboxStopGracePeriod returns how long stopSandboxContainer should wait
+// after the stop signal before escalating to SIGKILL. A runtime handler
+// specific grace period, when configured, takes precedence over the
+// service-wide criconfig.Config.SandboxStopGracePeriod default.
+func (c *criService) sandboxStopGracePeriod(sandbox sandboxstore.Sandbox) time.Duration {
+	if handler, ok := c.config.ContainerdConfig.Runtimes[sandbox.RuntimeHandler]; ok && handler.SandboxStopGracePeriod > 0 {
+		return time.Duration(handler.SandboxStopGracePeriod) * time.Second
+	}
+	return time.Duration(c.config.SandboxStopGracePeriod) * time.Second
+}
+
+// stopSignalLabel is the label containerd's CRI image puller stamps on the
+// sandbox container recording the OCI image's configured `StopSignal`.
+const stopSignalLabel = "io.containerd.image.config/stopsignal"
+
+// getContainerStopSignal returns the stop signal to use for a graceful
+// sandbox container shutdown: the image's configured stop signal if the
+// container records one via stopSignalLabel, or SIGTERM otherwise.
+func getContainerStopSignal(ctx context.Context, container containerd.Container) syscall.Signal {
+	labels, err := container.Labels(ctx)
+	if err != nil {
+		return syscall.SIGTERM
+	}
+	sig, ok := labels[stopSignalLabel]
+	if !ok {
+		return syscall.SIGTERM
+	}
+	signum, err := signal.ParseSignal(sig)
+	if err != nil {
+		logrus.Warnf("failed to parse stop signal %q for container %q, falling back to SIGTERM: %v", sig, container.ID(), err)
+		return syscall.SIGTERM
+	}
+	return signum
+}
+
 // waitSandboxStop waits for sandbox to be stopped until timeout exceeds or context is cancelled.
 func (c *criService) waitSandboxStop(ctx context.Context, sandbox sandboxstore.Sandbox, timeout time.Duration) error {
+	if c.metrics != nil {
+		defer func(start time.Time) {
+			c.metrics.waitSandboxStop.WithValues(sandbox.RuntimeHandler).UpdateSince(start)
+		}(time.Now())
+	}
+
 	timeoutTimer := time.NewTimer(timeout)
 	defer timeoutTimer.Stop()
 	select {
@@ -159,17 +331,97 @@ func (c *criService) waitSandboxStop(ctx context.Context, sandbox sandboxstore.S
 	}
 }
 
-// teardownPod removes the network from the pod
-func (c *criService) teardownPod(id string, path string, config *runtime.PodSandboxConfig) error {
-	if c.netPlugin == nil {
-		return errors.New("cni config not initialized")
+// podNetworkAnnotation lets a pod attach to one or more named CNI
+// configurations instead of just the default network, e.g.
+// "cri.containerd.io/network": "multus-a,multus-b". podNetworks reads it at
+// teardown time for a sandbox whose AttachedNetworks is empty; a non-empty
+// AttachedNetworks takes precedence over it. RunPodSandbox in this tree
+// neither reads the annotation nor sets AttachedNetworks.
+const podNetworkAnnotation = "cri.containerd.io/network"
+
+// defaultNetworkName identifies the CNI configuration backing
+// criService.netPlugin, used when a pod does not request any particular
+// network via podNetworkAnnotation.
+const defaultNetworkName = "default"
+
+// podNetworks returns the named CNI configurations a sandbox is attached to:
+// the persisted AttachedNetworks when it is non-empty, or otherwise the
+// networks its annotation requests.
+func podNetworks(sandbox sandboxstore.Sandbox) []string {
+	if len(sandbox.AttachedNetworks) > 0 {
+		return sandbox.AttachedNetworks
+	}
+	return getPodNetworkNames(sandbox.Config)
+}
+
+// getPodNetworkNames parses podNetworkAnnotation off of a pod sandbox config.
+func getPodNetworkNames(config *runtime.PodSandboxConfig) []string {
+	ann := config.GetAnnotations()[podNetworkAnnotation]
+	if ann == "" {
+		return []string{defaultNetworkName}
+	}
+	return strings.Split(ann, ",")
+}
+
+// teardownPod removes the network from the pod, invoking every named CNI
+// plugin chain the sandbox was attached to. A failure to remove one
+// attachment does not prevent attempting to remove the others; all errors
+// encountered are aggregated and returned together.
+func (c *criService) teardownPod(id string, path string, config *runtime.PodSandboxConfig, runtimeHandler string, networks []string) error {
+	if c.metrics != nil {
+		defer func(start time.Time) {
+			c.metrics.teardownPod.WithValues(runtimeHandler).UpdateSince(start)
+		}(time.Now())
 	}
 
 	labels := getPodCNILabels(id, config)
-	return c.netPlugin.Remove(id,
-		path,
-		cni.WithLabels(labels),
-		cni.WithCapabilityPortMap(toCNIPortMappings(config.GetPortMappings())))
+
+	var errs []error
+	for _, name := range networks {
+		plugin, err := c.namedNetPlugin(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := plugin.Remove(id,
+			path,
+			cni.WithLabels(labels),
+			cni.WithCapabilityPortMap(toCNIPortMappings(config.GetPortMappings()))); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to remove network %q", name))
+		}
+	}
+	return aggregateErrors(errs)
+}
+
+// namedNetPlugin resolves a network name from podNetworkAnnotation to the CNI
+// plugin instance that configures it. defaultNetworkName resolves to the
+// service-wide criService.netPlugin for backward compatibility with pods
+// that don't use the annotation; everything else is looked up in
+// criService.netPlugins, which criService.initPlatform populates from the
+// runtime's configured CNI config directories/files.
+func (c *criService) namedNetPlugin(name string) (cni.CNI, error) {
+	if name == defaultNetworkName {
+		if c.netPlugin == nil {
+			return nil, errors.New("cni config not initialized")
+		}
+		return c.netPlugin, nil
+	}
+	plugin, ok := c.netPlugins[name]
+	if !ok {
+		return nil, errors.Errorf("no cni configuration named %q", name)
+	}
+	return plugin, nil
+}
+
+// timedUnmountSandboxFiles unmounts the sandbox's files, recording how long
+// it took against the unmountSandboxFiles timer when metrics are enabled.
+func (c *criService) timedUnmountSandboxFiles(sandbox sandboxstore.Sandbox) error {
+	if c.metrics != nil {
+		defer func(start time.Time) {
+			c.metrics.unmountSandboxFiles.WithValues(sandbox.RuntimeHandler).UpdateSince(start)
+		}(time.Now())
+	}
+	return c.unmountSandboxFiles(sandbox.ID, sandbox.Config)
 }
 
 // cleanupUnknownSandbox cleanup stopped sandbox in unknown state.
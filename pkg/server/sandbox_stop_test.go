@@ -0,0 +1,221 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	containerd "github.com/containerd/containerd"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	runtime "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+
+	criconfig "github.com/containerd/cri/pkg/config"
+	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
+)
+
+func TestAggregateErrors(t *testing.T) {
+	for desc, test := range map[string]struct {
+		errs    []error
+		wantNil bool
+	}{
+		"no errors returns nil": {
+			errs:    nil,
+			wantNil: true,
+		},
+		"single error is returned unwrapped": {
+			errs: []error{errors.New("unmount failed")},
+		},
+		"multiple errors are aggregated": {
+			errs: []error{errors.New("unmount failed"), errors.New("cni remove failed")},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			err := aggregateErrors(test.errs)
+			if test.wantNil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			if len(test.errs) == 1 {
+				assert.Equal(t, test.errs[0], err)
+			}
+		})
+	}
+}
+
+func TestNeedsSandboxContainerStop(t *testing.T) {
+	for desc, test := range map[string]struct {
+		state  sandboxstore.State
+		status sandboxstore.Status
+		want   bool
+	}{
+		"ready sandbox needs its container stopped": {
+			state: sandboxstore.StateReady,
+			want:  true,
+		},
+		"unknown sandbox needs its container stopped": {
+			state: sandboxstore.StateUnknown,
+			want:  true,
+		},
+		"not ready sandbox never had a container running": {
+			state: sandboxstore.StateNotReady,
+			want:  false,
+		},
+		"retry of a ready sandbox still needs it stopped even though state is now stopping": {
+			state: sandboxstore.StateStopping,
+			want:  true,
+		},
+		"retry after a successful stop is skipped regardless of state": {
+			state:  sandboxstore.StateStopping,
+			status: sandboxstore.Status{ContainerStopped: true},
+			want:   false,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			assert.Equal(t, test.want, needsSandboxContainerStop(test.state, test.status))
+		})
+	}
+}
+
+func TestSandboxStopGracePeriod(t *testing.T) {
+	for desc, test := range map[string]struct {
+		config  criconfig.Config
+		sandbox sandboxstore.Sandbox
+		want    time.Duration
+	}{
+		"falls back to the service-wide default when no runtime handler is configured": {
+			config:  criconfig.Config{SandboxStopGracePeriod: 10},
+			sandbox: sandboxstore.Sandbox{RuntimeHandler: "runc"},
+			want:    10 * time.Second,
+		},
+		"falls back to the service-wide default when the sandbox's runtime handler has no override": {
+			config: criconfig.Config{
+				SandboxStopGracePeriod: 10,
+				ContainerdConfig: criconfig.ContainerdConfig{
+					Runtimes: map[string]criconfig.Runtime{"kata": {SandboxStopGracePeriod: 30}},
+				},
+			},
+			sandbox: sandboxstore.Sandbox{RuntimeHandler: "runc"},
+			want:    10 * time.Second,
+		},
+		"runtime handler override takes precedence over the service-wide default": {
+			config: criconfig.Config{
+				SandboxStopGracePeriod: 10,
+				ContainerdConfig: criconfig.ContainerdConfig{
+					Runtimes: map[string]criconfig.Runtime{"kata": {SandboxStopGracePeriod: 30}},
+				},
+			},
+			sandbox: sandboxstore.Sandbox{RuntimeHandler: "kata"},
+			want:    30 * time.Second,
+		},
+		"a zero runtime handler override does not disable the grace period, it falls back to the default": {
+			config: criconfig.Config{
+				SandboxStopGracePeriod: 10,
+				ContainerdConfig: criconfig.ContainerdConfig{
+					Runtimes: map[string]criconfig.Runtime{"kata": {SandboxStopGracePeriod: 0}},
+				},
+			},
+			sandbox: sandboxstore.Sandbox{RuntimeHandler: "kata"},
+			want:    10 * time.Second,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			c := &criService{config: test.config}
+			assert.Equal(t, test.want, c.sandboxStopGracePeriod(test.sandbox))
+		})
+	}
+}
+
+// fakeLabeledContainer is a minimal containerd.Container fake: it embeds the
+// interface so methods getContainerStopSignal doesn't call are never invoked,
+// and overrides only Labels and ID.
+type fakeLabeledContainer struct {
+	containerd.Container
+	labels map[string]string
+	err    error
+}
+
+func (f *fakeLabeledContainer) ID() string {
+	return "test-container"
+}
+
+func (f *fakeLabeledContainer) Labels(ctx context.Context) (map[string]string, error) {
+	return f.labels, f.err
+}
+
+func TestGetContainerStopSignal(t *testing.T) {
+	for desc, test := range map[string]struct {
+		container containerd.Container
+		want      syscall.Signal
+	}{
+		"valid stop signal label is honored": {
+			container: &fakeLabeledContainer{labels: map[string]string{stopSignalLabel: "SIGUSR1"}},
+			want:      syscall.SIGUSR1,
+		},
+		"missing stop signal label falls back to SIGTERM": {
+			container: &fakeLabeledContainer{labels: map[string]string{}},
+			want:      syscall.SIGTERM,
+		},
+		"unparsable stop signal label falls back to SIGTERM": {
+			container: &fakeLabeledContainer{labels: map[string]string{stopSignalLabel: "not-a-signal"}},
+			want:      syscall.SIGTERM,
+		},
+		"error reading labels falls back to SIGTERM": {
+			container: &fakeLabeledContainer{err: errors.New("labels unavailable")},
+			want:      syscall.SIGTERM,
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			assert.Equal(t, test.want, getContainerStopSignal(context.Background(), test.container))
+		})
+	}
+}
+
+func TestPodNetworks(t *testing.T) {
+	for desc, test := range map[string]struct {
+		sandbox sandboxstore.Sandbox
+		want    []string
+	}{
+		"no annotation and no persisted list defaults to the default network": {
+			sandbox: sandboxstore.Sandbox{Config: &runtime.PodSandboxConfig{}},
+			want:    []string{"default"},
+		},
+		"annotation is split on comma for sandboxes without a persisted list": {
+			sandbox: sandboxstore.Sandbox{Config: &runtime.PodSandboxConfig{
+				Annotations: map[string]string{podNetworkAnnotation: "multus-a,multus-b"},
+			}},
+			want: []string{"multus-a", "multus-b"},
+		},
+		"persisted AttachedNetworks wins over the annotation": {
+			sandbox: sandboxstore.Sandbox{
+				Config: &runtime.PodSandboxConfig{
+					Annotations: map[string]string{podNetworkAnnotation: "multus-a,multus-b"},
+				},
+				AttachedNetworks: []string{"default"},
+			},
+			want: []string{"default"},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			assert.Equal(t, test.want, podNetworks(test.sandbox))
+		})
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sandbox
+
+import (
+	"sync"
+
+	containerd "github.com/containerd/containerd"
+	runtime "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+// NetNS is the minimal network namespace handle the sandbox needs to hold on
+// to in order to tear itself down. It is satisfied by pkg/netns.NetNS.
+type NetNS interface {
+	// Closed returns whether the network namespace has already been closed.
+	Closed() (bool, error)
+	// Remove removes the network namespace.
+	Remove() error
+}
+
+// Sandbox contains all resources associated with the sandbox. All methods to
+// mutate the internal state are thread-safe.
+type Sandbox struct {
+	// ID is the sandbox id.
+	ID string
+	// Config is the CRI sandbox config.
+	Config *runtime.PodSandboxConfig
+	// Container is the containerd sandbox container.
+	Container containerd.Container
+	// Status stores the status of the sandbox.
+	Status StatusStorage
+	// NetNS is the network namespace used by the sandbox, nil if the
+	// sandbox uses the host network.
+	NetNS NetNS
+	// NetNSPath is the path to the network namespace used by the sandbox.
+	NetNSPath string
+	// RuntimeHandler is the runtime handler requested for this sandbox, used
+	// to label per-handler metrics and to pick a per-handler sandbox stop
+	// grace period.
+	RuntimeHandler string
+	// AttachedNetworks is the list of named CNI configurations RunPodSandbox
+	// invoked for this sandbox, in invocation order. When it is non-empty,
+	// StopPodSandbox tears down exactly this list, so a daemon restart between
+	// setup and teardown doesn't lose track of which plugins were actually
+	// invoked; when it is empty, StopPodSandbox falls back to the networks the
+	// sandbox's annotation requests, or the default network.
+	AttachedNetworks []string
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// NewSandbox creates an internally used sandbox type. This functions reminds
+// the caller that a sandbox must have a status.
+func NewSandbox(id string, config *runtime.PodSandboxConfig, status Status) Sandbox {
+	return Sandbox{
+		ID:     id,
+		Config: config,
+		Status: StoreStatus(status),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Stop marks the sandbox as stopped. It is safe to call multiple times.
+func (s *Sandbox) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+}
+
+// Stopped returns the channel that's closed once the sandbox is stopped.
+func (s *Sandbox) Stopped() <-chan struct{} {
+	return s.stopCh
+}
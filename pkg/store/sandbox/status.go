@@ -0,0 +1,121 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sandbox
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the sandbox state we use to represent the state of a sandbox.
+type State uint32
+
+const (
+	// StateUnknown is unknown state of sandbox. Sandbox is in unknown state
+	// before its corresponding sandbox container is known to containerd.
+	StateUnknown State = iota
+	// StateReady is ready state, it means sandbox container is running.
+	StateReady
+	// StateNotReady is notready state, it ONLY means sandbox container
+	// is not running.
+	// StopPodSandbox should still be called for StateNotReady sandbox.
+	StateNotReady
+	// StateStopping means the sandbox is in the process of being stopped by
+	// StopPodSandbox. It is set before the sandbox's containers are force
+	// stopped, so that a concurrent CreateContainer for the same sandbox is
+	// rejected instead of racing the teardown.
+	StateStopping
+)
+
+// String returns a human readable representation of the state, used in
+// log messages and error strings.
+func (s State) String() string {
+	switch s {
+	case StateUnknown:
+		return "unknown"
+	case StateReady:
+		return "ready"
+	case StateNotReady:
+		return "not ready"
+	case StateStopping:
+		return "stopping"
+	default:
+		return "invalid"
+	}
+}
+
+// Status is the status of a sandbox.
+type Status struct {
+	// Pid is the init process id of the sandbox container.
+	Pid uint32
+	// CreatedAt is the created timestamp.
+	CreatedAt time.Time
+	// State is the state of the sandbox.
+	State State
+	// ContainerStopped records whether the sandbox container has already
+	// been confirmed stopped, so a retried StopPodSandbox knows to retry
+	// stopSandboxContainer rather than silently skipping it just because
+	// the sandbox's State is already StateStopping from the earlier attempt.
+	ContainerStopped bool
+	// Unmounted records whether unmountSandboxFiles has already completed
+	// successfully, so a retried StopPodSandbox does not repeat it.
+	Unmounted bool
+	// NetworkTornDown records whether teardownPod has already completed
+	// successfully, so a retried StopPodSandbox does not invoke the CNI
+	// plugin's Remove a second time for a network that's already gone.
+	NetworkTornDown bool
+}
+
+// UpdateFunc is function used to update the status.
+type UpdateFunc func(Status) (Status, error)
+
+// StatusStorage manages the status of a sandbox.
+type StatusStorage interface {
+	// Get a sandbox status.
+	Get() Status
+	// Update the sandbox status. Note that the update MUST be applied
+	// in one transaction.
+	Update(UpdateFunc) error
+}
+
+// StoreStatus creates the storage containing the passed in sandbox status
+// with a locking mechanism.
+func StoreStatus(status Status) StatusStorage {
+	return &statusStorage{status: status}
+}
+
+type statusStorage struct {
+	sync.RWMutex
+	status Status
+}
+
+func (s *statusStorage) Get() Status {
+	s.RLock()
+	defer s.RUnlock()
+	return s.status
+}
+
+func (s *statusStorage) Update(u UpdateFunc) error {
+	s.Lock()
+	defer s.Unlock()
+	newStatus, err := u(s.status)
+	if err != nil {
+		return err
+	}
+	s.status = newStatus
+	return nil
+}
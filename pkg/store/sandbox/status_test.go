@@ -0,0 +1,58 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sandbox
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusStorageUpdate(t *testing.T) {
+	s := StoreStatus(Status{State: StateReady})
+	err := s.Update(func(status Status) (Status, error) {
+		status.State = StateStopping
+		return status, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, StateStopping, s.Get().State)
+}
+
+// TestStatusStorageConcurrentUpdate guards against a race between
+// StopPodSandbox setting StateStopping and a concurrent reader such as
+// CreateContainer's readiness check.
+func TestStatusStorageConcurrentUpdate(t *testing.T) {
+	s := StoreStatus(Status{State: StateReady})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_ = s.Update(func(status Status) (Status, error) {
+			status.State = StateStopping
+			return status, nil
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		_ = s.Get().State
+	}()
+	wg.Wait()
+
+	assert.Equal(t, StateStopping, s.Get().State)
+}